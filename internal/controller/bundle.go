@@ -0,0 +1,141 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/DataTunerX/dataset-controller/pkg/resourceset"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
+)
+
+// fieldManager is the stable field manager used for every server-side apply
+// issued by the controller, so resources created by a plugin bundle can be
+// safely co-owned by other actors without fighting over fields they don't set.
+const fieldManager = "dataset-controller"
+
+// yamlDocSeparator matches a `---` document separator on its own line.
+var yamlDocSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// clusterScopedKinds holds the kinds a plugin bundle may contain that are not
+// namespaced, and therefore must not have a namespace or controller
+// reference set on them.
+var clusterScopedKinds = map[string]bool{
+	"Namespace":                true,
+	"ClusterRole":              true,
+	"ClusterRoleBinding":       true,
+	"CustomResourceDefinition": true,
+}
+
+// bundleKindPriority returns the apply-order tier for a kind, lower applies
+// first. Kinds not listed fall back to the last tier. This mirrors the
+// ordered-install pattern used by ONAP rsync: namespaces and CRDs must exist
+// before anything that lives inside them, RBAC before workloads, storage
+// before the jobs that mount it.
+func bundleKindPriority(kind string) int {
+	switch kind {
+	case "Namespace":
+		return 0
+	case "CustomResourceDefinition":
+		return 1
+	case "ServiceAccount":
+		return 2
+	case "Role", "ClusterRole", "RoleBinding", "ClusterRoleBinding":
+		return 3
+	case "ConfigMap", "Secret":
+		return 4
+	case "PersistentVolumeClaim":
+		return 5
+	case "Service":
+		return 6
+	case "Deployment", "Job", "CronJob":
+		return 7
+	default:
+		return 8
+	}
+}
+
+// splitYAMLDocuments splits a multi-document YAML file on `---` separators,
+// dropping any documents that are empty once whitespace is trimmed.
+func splitYAMLDocuments(data []byte) [][]byte {
+	var docs [][]byte
+	for _, raw := range yamlDocSeparator.Split(string(data), -1) {
+		doc := bytes.TrimSpace([]byte(raw))
+		if len(doc) == 0 {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// decodeDocument decodes a single YAML document into an unstructured.Unstructured.
+func decodeDocument(doc []byte) (*unstructured.Unstructured, error) {
+	decUnstructured := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
+	obj := &unstructured.Unstructured{}
+	if _, _, err := decUnstructured.Decode(doc, nil, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// sortForApply orders a bundle by bundleKindPriority so that prerequisites
+// (Namespace, CRDs, ServiceAccount, RBAC, ConfigMap/Secret, PVC) are applied
+// before the resources that depend on them.
+func sortForApply(objs []*unstructured.Unstructured) {
+	sortBundle(objs, false)
+}
+
+// sortForDelete orders a bundle in the reverse of apply order, so dependents
+// are torn down before the prerequisites they relied on.
+func sortForDelete(objs []*unstructured.Unstructured) {
+	sortBundle(objs, true)
+}
+
+func sortBundle(objs []*unstructured.Unstructured, reverse bool) {
+	priority := func(obj *unstructured.Unstructured) int {
+		return bundleKindPriority(obj.GetKind())
+	}
+	// Simple insertion sort is plenty for plugin bundles, which are a
+	// handful of documents at most.
+	for i := 1; i < len(objs); i++ {
+		for j := i; j > 0; j-- {
+			pj, pj1 := priority(objs[j]), priority(objs[j-1])
+			swap := pj < pj1
+			if reverse {
+				swap = pj > pj1
+			}
+			if !swap {
+				break
+			}
+			objs[j], objs[j-1] = objs[j-1], objs[j]
+		}
+	}
+}
+
+// toAppliedResource records the identity of an applied object for the
+// Dataset's applied-resources annotation (see pkg/resourceset).
+func toAppliedResource(obj *unstructured.Unstructured) resourceset.Item {
+	return resourceset.Item{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+}
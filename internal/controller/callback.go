@@ -0,0 +1,95 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/DataTunerX/dataset-controller/pkg/callback"
+	"github.com/DataTunerX/dataset-controller/pkg/config"
+	extensionv1beta1 "github.com/DataTunerX/meta-server/api/extension/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// callbackAddr is where the controller listens for plugin completion
+// callbacks. Deliberately not :9443: that's the port controller-runtime's
+// webhook server conventionally binds, and RunCallbackServer runs alongside
+// it in the same manager.
+const callbackAddr = ":9446"
+
+// NewCallbackServer wires up the callback HTTP server against this
+// reconciler's client: it reads a Dataset's HMAC secret to verify a
+// completion POST and patches Dataset.Status with the reported result.
+func (r *DatasetReconciler) NewCallbackServer() *callback.Server {
+	return callback.NewServer(callback.ClientSecretLookup(r.Client), r.patchDatasetComplete)
+}
+
+// patchDatasetComplete applies a verified completion Payload onto a
+// Dataset's status.
+func (r *DatasetReconciler) patchDatasetComplete(ctx context.Context, namespace, name string, payload callback.Payload) error {
+	var dataset extensionv1beta1.Dataset
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &dataset); err != nil {
+		return err
+	}
+
+	switch payload.State {
+	case "Succeeded":
+		dataset.Status.State = extensionv1beta1.DatasetReady
+	case "Failed":
+		dataset.Status.State = extensionv1beta1.DatasetUnready
+	}
+	dataset.Status.Message = payload.Message
+	dataset.Status.Artifacts = payload.Artifacts
+
+	return r.Status().Update(ctx, &dataset)
+}
+
+// RunCallbackServer serves plugin completion callbacks until ctx is
+// cancelled. Its signature matches manager.RunnableFunc, so main wires it up
+// with `mgr.Add(manager.RunnableFunc(reconciler.RunCallbackServer))`.
+//
+// The callback carries an HMAC-signed payload, but the request itself is
+// only as trustworthy as the channel it arrives over: when both
+// CALLBACK_TLS_CERT_FILE and CALLBACK_TLS_KEY_FILE are set, the server serves
+// HTTPS; when neither is set it falls back to plain HTTP, which is fine for
+// same-cluster plugin pods but shouldn't be exposed beyond that. Setting only
+// one of the two is an error.
+func (r *DatasetReconciler) RunCallbackServer(ctx context.Context) error {
+	srv := &http.Server{Addr: callbackAddr, Handler: r.NewCallbackServer().Handler()}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	certFile, keyFile := config.GetCallbackTLSCertFile(), config.GetCallbackTLSKeyFile()
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf("callback server: both CALLBACK_TLS_CERT_FILE and CALLBACK_TLS_KEY_FILE must be set to enable TLS, got cert=%q key=%q", certFile, keyFile)
+	}
+
+	var err error
+	if certFile != "" && keyFile != "" {
+		err = srv.ListenAndServeTLS(certFile, keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("callback server: %w", err)
+	}
+	return nil
+}
@@ -20,19 +20,21 @@ import (
 	"context"
 	"encoding/json"
 	"os"
-	"path/filepath"
+	"time"
 
+	"github.com/DataTunerX/dataset-controller/pkg/callback"
 	"github.com/DataTunerX/dataset-controller/pkg/config"
+	"github.com/DataTunerX/dataset-controller/pkg/resourceset"
+	"github.com/DataTunerX/dataset-controller/pkg/snapshot"
+	"github.com/DataTunerX/dataset-controller/pkg/template"
 	extensionv1beta1 "github.com/DataTunerX/meta-server/api/extension/v1beta1" // import DataPlugin API
 	logging "github.com/DataTunerX/utility-server/logging"
-	parser "github.com/DataTunerX/utility-server/parser"
-	"github.com/qiniu/x/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
@@ -42,6 +44,13 @@ type DatasetReconciler struct {
 	client.Client
 	Log    logging.Logger
 	Scheme *runtime.Scheme
+
+	// snapshotManager materializes a Dataset's source data onto a PVC. It's
+	// built lazily on first use so DatasetReconciler can keep being
+	// constructed the same way it always has been.
+	snapshotManager *snapshot.Manager
+	// templateEngine renders plugin bundle documents; also built lazily.
+	templateEngine *template.Engine
 }
 
 //+kubebuilder:rbac:groups=extension.datatunerx.io,resources=datasets,verbs=get;list;watch;create;update;patch;delete
@@ -69,6 +78,36 @@ func (r *DatasetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// Handle deletion: clean up everything a plugin bundle applied for this
+	// Dataset before letting the delete through.
+	if !dataset.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(&dataset, datasetFinalizer) {
+			applied, err := resourceset.Decode(dataset.GetAnnotations()[resourceset.Annotation])
+			if err != nil {
+				r.Log.Errorf("unable to decode applied resources annotation: %v", err)
+				return ctrl.Result{}, err
+			}
+			if err := r.deleteAppliedResources(ctx, applied); err != nil {
+				r.Log.Errorf("unable to clean up applied resources: %v", err)
+				return ctrl.Result{}, err
+			}
+			controllerutil.RemoveFinalizer(&dataset, datasetFinalizer)
+			if err := r.Update(ctx, &dataset); err != nil {
+				r.Log.Errorf("unable to remove finalizer: %v", err)
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(&dataset, datasetFinalizer) {
+		controllerutil.AddFinalizer(&dataset, datasetFinalizer)
+		if err := r.Update(ctx, &dataset); err != nil {
+			r.Log.Errorf("unable to add finalizer: %v", err)
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Check if dataset.spec.datasetmetadata.subsets is not empty
 	if !isSubsetInfoValid(dataset.Spec.DatasetMetadata.DatasetInfo.Subsets) {
 		// If subsets are not valid, set dataset status to UNREADY and return
@@ -79,6 +118,53 @@ func (r *DatasetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		}
 	}
 
+	// Materialize the dataset's source data onto a PVC, when a source is
+	// configured, skipping the download Job once the PVC already matches
+	// the current source+revision.
+	if source := dataset.Spec.DatasetMetadata.DatasetInfo.Source; source != "" {
+		if r.snapshotManager == nil {
+			r.snapshotManager = snapshot.NewManager(r.Client, r.Scheme)
+		}
+
+		snapStatus, snapErr := r.snapshotManager.Ensure(ctx, &dataset, snapshot.Status{
+			PVCName:      dataset.Status.Snapshot.PVCName,
+			SourceDigest: dataset.Status.Snapshot.SourceDigest,
+			ContentHash:  dataset.Status.Snapshot.ContentHash,
+			Ready:        dataset.Status.Snapshot.Ready,
+		}, source, dataset.Spec.DatasetMetadata.DatasetInfo.Revision)
+		if snapErr != nil {
+			r.Log.Errorf("unable to snapshot dataset source: %v", snapErr)
+		}
+
+		// Persist snapStatus even when Ensure errored: a failed Job still
+		// carries a PVCName/SourceDigest worth recording, and without this
+		// a failure would leave no trace on the Dataset and the next
+		// reconcile would never know a snapshot was ever attempted.
+		dataset.Status.Snapshot.PVCName = snapStatus.PVCName
+		dataset.Status.Snapshot.SourceDigest = snapStatus.SourceDigest
+		dataset.Status.Snapshot.ContentHash = snapStatus.ContentHash
+		dataset.Status.Snapshot.Ready = snapStatus.Ready
+		if snapErr == nil {
+			dataset.Status.State = extensionv1beta1.DatasetReady
+		} else {
+			dataset.Status.State = extensionv1beta1.DatasetUnready
+		}
+		if err := r.Status().Update(ctx, &dataset); err != nil {
+			r.Log.Errorf("unable to update Dataset snapshot status: %v", err)
+			return ctrl.Result{}, err
+		}
+		if snapErr != nil {
+			// Requeue to retry. When the error was a failed Job, Ensure
+			// already deleted it, so the next reconcile's ensureJob
+			// recreates it and gives the source another chance instead of
+			// failing forever.
+			return ctrl.Result{RequeueAfter: requeueInterval}, nil
+		}
+		if !snapStatus.Ready {
+			return ctrl.Result{RequeueAfter: requeueInterval}, nil
+		}
+	}
+
 	// Fetch the DataPlugin instance used by the dataset
 	var dataPlugin extensionv1beta1.DataPlugin
 	if dataset.Spec.DatasetMetadata.Plugin.LoadPlugin {
@@ -91,11 +177,21 @@ func (r *DatasetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 			return ctrl.Result{}, client.IgnoreNotFound(err)
 		}
 
-		// Build the path to the plugin YAML file
-		pluginPath := filepath.Join("plugins", dataPlugin.Spec.DatasetClass, dataPlugin.Spec.Provider, "plugin.yaml")
-		// Apply the plugin YAML file
-		if err := r.applyYAML(ctx, pluginPath, &dataset); err != nil {
-			r.Log.Errorf("unable to apply plugin YAML %v: %v", pluginPath, err)
+		// Resolve the plugin bundle, either from the baked-in plugins/ tree
+		// or, when DataPlugin.Spec.Source is set, from a remote registry.
+		bundleFile, err := r.resolveBundle(ctx, &dataPlugin)
+		if err != nil {
+			r.Log.Errorf("unable to resolve plugin bundle for %v: %v", dataPluginName, err)
+			return ctrl.Result{}, err
+		}
+
+		// Apply the plugin bundle
+		if err := r.applyBundle(ctx, bundleFile, &dataset); err != nil {
+			if isNotReady(err) {
+				r.Log.Infof("plugin bundle %v not ready yet, requeuing: %v", dataPluginName, err)
+				return ctrl.Result{RequeueAfter: requeueInterval}, nil
+			}
+			r.Log.Errorf("unable to apply plugin bundle %v: %v", dataPluginName, err)
 			return ctrl.Result{}, err
 		}
 	}
@@ -117,57 +213,109 @@ func isSubsetInfoValid(subsets []extensionv1beta1.Subset) bool {
 	return false
 }
 
-// applyYAML reads a YAML file, replaces placeholders with environment variable values, and applies its content to the Kubernetes cluster
-func (r *DatasetReconciler) applyYAML(ctx context.Context, path string, dataset *extensionv1beta1.Dataset) error {
+// requeueInterval is how long the reconciler waits before retrying work
+// that isn't ready yet: a plugin bundle prerequisite, or a snapshot Job.
+const requeueInterval = 5 * time.Second
+
+// applyBundle takes a plugin bundle (a possibly multi-document YAML file),
+// replaces placeholders in each document, and applies the documents to the
+// cluster in dependency order: Namespace, then CRDs, ServiceAccount, RBAC,
+// ConfigMap/Secret, PVC, Service, and finally Deployment/Job/CronJob.
+// Prerequisites are awaited before their dependents are applied, and every
+// applied object is recorded in the Dataset's resourceset.Annotation so a
+// later reconcile can garbage-collect resources that drop out of the bundle.
+func (r *DatasetReconciler) applyBundle(ctx context.Context, bundleFile []byte, dataset *extensionv1beta1.Dataset) error {
+	// Replace placeholders with environment variable values and run-time
+	// parameters defined in the dataset, document by document, then decode
+	// each document into an unstructured.Unstructured.
+	var objs []*unstructured.Unstructured
+	for _, doc := range splitYAMLDocuments(bundleFile) {
+		replaced, err := r.replacePlaceholders(ctx, string(doc), dataset)
+		if err != nil {
+			r.Log.Errorf("unable to replace placeholders in YAML: %v", err)
+			return err
+		}
+		decoded, err := decodeDocument([]byte(replaced))
+		if err != nil {
+			r.Log.Errorf("unable to decode plugin bundle document: %v", err)
+			return err
+		}
+		objs = append(objs, decoded)
+	}
+
+	sortForApply(objs)
 
-	r.Log.Infof("Applying plugin YAML %v", path)
-	// Read the YAML file content
-	yamlFile, err := os.ReadFile(path)
+	previouslyApplied, err := resourceset.Decode(dataset.GetAnnotations()[resourceset.Annotation])
 	if err != nil {
-		r.Log.Errorf("unable to read plugin YAML file: %v", err)
+		r.Log.Errorf("unable to decode applied resources annotation: %v", err)
 		return err
 	}
 
-	// Convert the file content to a string
-	yamlStr := string(yamlFile)
+	applied := make([]resourceset.Item, 0, len(objs))
+	for _, obj := range objs {
+		if !clusterScopedKinds[obj.GetKind()] {
+			obj.SetNamespace(dataset.GetNamespace())
+		}
+		applied = append(applied, toAppliedResource(obj))
+	}
 
-	// Replace placeholders with environment variable values and run-time parameters defined in the dataset
-	replacedYamlStr, err := r.replacePlaceholders(yamlStr, dataset)
-	if err != nil {
-		r.Log.Errorf("unable to replace placeholders in YAML: %v", err)
-		return err
+	// Garbage-collect resources the previous bundle applied but the current
+	// one no longer does, e.g. because Spec.Plugin switched providers, before
+	// applying the new bundle: applying first would let the departed and
+	// replacement resources briefly coexist, tripping namespace resource
+	// quotas the cluster operator sized for one bundle at a time.
+	if departed := diffDeparted(previouslyApplied, applied); len(departed) > 0 {
+		if err := r.deleteAppliedResources(ctx, departed); err != nil {
+			return err
+		}
 	}
 
-	// Convert the updated YAML string back to a byte slice
-	yamlFile = []byte(replacedYamlStr)
+	for _, obj := range objs {
+		if !clusterScopedKinds[obj.GetKind()] {
+			if err := ctrl.SetControllerReference(dataset, obj, r.Scheme); err != nil {
+				r.Log.Errorf("unable to set controller reference: %v", err)
+				return err
+			}
+		}
 
-	// Decode the YAML into an unstructured.Unstructured object
-	decUnstructured := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
-	unstructuredObj := &unstructured.Unstructured{}
-	_, _, err = decUnstructured.Decode(yamlFile, nil, unstructuredObj)
-	if err != nil {
-		r.Log.Errorf("unable to decode YAML into Unstructured: %v", err)
-		return err
+		for _, prereq := range objs {
+			if prereq == obj {
+				break
+			}
+			if err := waitForPrerequisite(ctx, r.Client, prereq); err != nil {
+				return err
+			}
+		}
+
+		if err := r.applyClient(ctx, obj); err != nil {
+			r.Log.Errorf("unable to apply %v %v/%v: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+			return err
+		}
 	}
 
-	// Set the namespace and owner reference
-	unstructuredObj.SetNamespace(dataset.GetNamespace())
-	if err := ctrl.SetControllerReference(dataset, unstructuredObj, r.Scheme); err != nil {
-		r.Log.Errorf("unable to set controller reference: %v", err)
+	encoded, err := resourceset.Encode(applied)
+	if err != nil {
+		r.Log.Errorf("unable to encode applied resources: %v", err)
 		return err
 	}
-
-	// Apply the unstructured object using the client
-	if err := r.applyClient(ctx, unstructuredObj); err != nil {
-		r.Log.Errorf("unable to apply Unstructured object: %v", err)
+	if dataset.Annotations == nil {
+		dataset.Annotations = make(map[string]string, 1)
+	}
+	dataset.Annotations[resourceset.Annotation] = encoded
+	if err := r.Update(ctx, dataset); err != nil {
+		r.Log.Errorf("unable to record applied resources annotation on Dataset: %v", err)
 		return err
 	}
 
 	return nil
 }
 
-// replacePlaceholders replaces a specific placeholder in the YAML file with the value from an environment variable
-func (r *DatasetReconciler) replacePlaceholders(yamlStr string, dataset *extensionv1beta1.Dataset) (string, error) {
+// replacePlaceholders renders a plugin bundle document against a template
+// context exposing the Dataset, its run-time Parameters, the controller's
+// environment and cluster namespaces, so plugin authors can pull in Secrets
+// and ConfigMaps (via secretRef/configMapRef) instead of embedding
+// credentials in Plugin.Parameters.
+func (r *DatasetReconciler) replacePlaceholders(ctx context.Context, yamlStr string, dataset *extensionv1beta1.Dataset) (string, error) {
 
 	// Parameters holding the unmarshaled parameters
 	var parameters map[string]interface{}
@@ -182,43 +330,65 @@ func (r *DatasetReconciler) replacePlaceholders(yamlStr string, dataset *extensi
 	// Add the required fields defined in the plugin standard to parameters
 	parameters["completeNotifyUrl"] = config.GetCompleteNotifyURL()
 
-	// Replace the value in template yaml
-	replacedYamlStr, err := parser.ReplaceTemplate(yamlStr, parameters)
+	// completeNotifySecret is the raw HMAC key the plugin signs its
+	// completion callback with; generated once per Dataset and persisted in
+	// a Secret so it stays stable across reconciles.
+	notifySecret, err := callback.EnsureSecret(ctx, r.Client, dataset, r.Scheme)
 	if err != nil {
-		r.Log.Errorf("unable to replace placeholders in YAML: %v", err)
+		r.Log.Errorf("unable to ensure complete-notify secret: %v", err)
 		return "", err
 	}
+	parameters["completeNotifySecret"] = notifySecret
 
-	return replacedYamlStr, nil
-}
+	datasetMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(dataset)
+	if err != nil {
+		r.Log.Errorf("unable to convert Dataset to template context: %v", err)
+		return "", err
+	}
 
-// applyClient applies or updates the given unstructured object in the cluster using the client
-func (r *DatasetReconciler) applyClient(ctx context.Context, obj *unstructured.Unstructured) error {
-	// First, try to get the resource, if it exists, update it
-	existing := &unstructured.Unstructured{}
-	existing.SetGroupVersionKind(obj.GroupVersionKind())
-	err := r.Get(ctx, client.ObjectKey{Name: obj.GetName(), Namespace: obj.GetNamespace()}, existing)
-	if err != nil && !errors.IsNotFound(err) {
-		r.Log.Errorf("unable to get existing resource: %v", err)
-		return err
+	if r.templateEngine == nil {
+		r.templateEngine = template.NewEngine(r.Client)
 	}
 
-	if err == nil {
-		// Resource exists, update it
-		obj.SetResourceVersion(existing.GetResourceVersion())
-		if err := r.Update(ctx, obj); err != nil {
-			r.Log.Errorf("unable to update resource: %v", err)
-			return err
-		}
-		r.Log.Info("resource updated successfully")
-	} else {
-		// Resource does not exist, create it
-		if err := r.Create(ctx, obj); err != nil {
-			r.Log.Errorf("unable to create resource: %v", err)
-			return err
+	rendered, err := r.templateEngine.Render(ctx, yamlStr, template.Context{
+		Dataset: datasetMap,
+		Params:  parameters,
+		Env:     envMap(),
+		Cluster: template.ClusterInfo{
+			Namespace:           dataset.GetNamespace(),
+			ControllerNamespace: config.GetDatatunerxSystemNamespace(),
+		},
+	})
+	if err != nil {
+		r.Log.Errorf("unable to render plugin bundle template: %v", err)
+		return "", err
+	}
+
+	return rendered, nil
+}
+
+// envMap exposes only template.EnvAllowlist from the controller process's
+// environment to plugin bundle templates — see Context.Env for why the full
+// environment must never be handed to a bundle.
+func envMap() map[string]string {
+	env := make(map[string]string, len(template.EnvAllowlist))
+	for _, key := range template.EnvAllowlist {
+		if value, ok := os.LookupEnv(key); ok {
+			env[key] = value
 		}
-		r.Log.Info("resource created successfully")
 	}
+	return env
+}
+
+// applyClient server-side applies the given unstructured object under the
+// dataset-controller field manager, so fields owned by other actors (e.g. a
+// plugin pod mutating its own ConfigMap) aren't clobbered on every reconcile.
+func (r *DatasetReconciler) applyClient(ctx context.Context, obj *unstructured.Unstructured) error {
+	if err := r.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		r.Log.Errorf("unable to apply resource: %v", err)
+		return err
+	}
+	r.Log.Infof("%v %v/%v applied successfully", obj.GetKind(), obj.GetNamespace(), obj.GetName())
 	return nil
 }
 
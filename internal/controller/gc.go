@@ -0,0 +1,77 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"github.com/DataTunerX/dataset-controller/pkg/resourceset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// datasetFinalizer is held on a Dataset for as long as it may own resources
+// applied by a plugin bundle, so deletion always gets a chance to garbage
+// collect them first.
+const datasetFinalizer = "extension.datatunerx.io/applied-resources"
+
+// diffDeparted returns the entries in previous that are no longer present in
+// current, i.e. resources a plugin bundle applied on an earlier reconcile
+// but that dropped out of the bundle (the plugin changed, or a document was
+// removed).
+func diffDeparted(previous, current []resourceset.Item) []resourceset.Item {
+	stillPresent := make(map[resourceset.Item]bool, len(current))
+	for _, r := range current {
+		stillPresent[r] = true
+	}
+
+	var departed []resourceset.Item
+	for _, r := range previous {
+		if !stillPresent[r] {
+			departed = append(departed, r)
+		}
+	}
+	return departed
+}
+
+// deleteAppliedResources foreground-deletes a set of previously applied
+// resources, in reverse apply order, so a Deployment is gone before the
+// ConfigMap it mounts, for example. Resources already gone are ignored.
+func (r *DatasetReconciler) deleteAppliedResources(ctx context.Context, items []resourceset.Item) error {
+	objs := make([]*unstructured.Unstructured, 0, len(items))
+	for _, res := range items {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(res.APIVersion)
+		obj.SetKind(res.Kind)
+		obj.SetNamespace(res.Namespace)
+		obj.SetName(res.Name)
+		objs = append(objs, obj)
+	}
+	sortForDelete(objs)
+
+	foreground := metav1.DeletePropagationForeground
+	for _, obj := range objs {
+		r.Log.Infof("deleting stale %v %v/%v", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+		if err := r.Delete(ctx, obj, &client.DeleteOptions{PropagationPolicy: &foreground}); err != nil && !apierrors.IsNotFound(err) {
+			r.Log.Errorf("unable to delete stale %v %v/%v: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// notReadyError is returned by waitForPrerequisite when a dependency exists
+// but hasn't reached the state a dependent resource needs. The reconciler
+// treats it as "requeue, don't fail".
+type notReadyError struct {
+	reason string
+}
+
+func (e *notReadyError) Error() string { return e.reason }
+
+// isNotReady reports whether err came from waitForPrerequisite finding a
+// not-yet-ready dependency, as opposed to a real apply failure.
+func isNotReady(err error) bool {
+	_, ok := err.(*notReadyError)
+	return ok
+}
+
+// waitForPrerequisite checks that obj, if it is a kind the rest of the
+// bundle can depend on, has reached a ready state before dependents are
+// applied. Kinds with no readiness notion of their own are always ready.
+func waitForPrerequisite(ctx context.Context, c client.Client, obj *unstructured.Unstructured) error {
+	switch obj.GetKind() {
+	case "Namespace":
+		return waitForNamespaceActive(ctx, c, obj)
+	case "PersistentVolumeClaim":
+		return waitForPVCBound(ctx, c, obj)
+	default:
+		return nil
+	}
+}
+
+func waitForNamespaceActive(ctx context.Context, c client.Client, obj *unstructured.Unstructured) error {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(obj.GroupVersionKind())
+	if err := c.Get(ctx, client.ObjectKey{Name: obj.GetName()}, current); err != nil {
+		return err
+	}
+	phase, _, _ := unstructured.NestedString(current.Object, "status", "phase")
+	if phase != "Active" {
+		return &notReadyError{reason: "namespace " + obj.GetName() + " is not Active yet"}
+	}
+	return nil
+}
+
+func waitForPVCBound(ctx context.Context, c client.Client, obj *unstructured.Unstructured) error {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(obj.GroupVersionKind())
+	if err := c.Get(ctx, client.ObjectKey{Name: obj.GetName(), Namespace: obj.GetNamespace()}, current); err != nil {
+		return err
+	}
+	phase, _, _ := unstructured.NestedString(current.Object, "status", "phase")
+	if phase != "Bound" {
+		return &notReadyError{reason: "PVC " + obj.GetName() + " is not Bound yet"}
+	}
+	return nil
+}
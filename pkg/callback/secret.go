@@ -0,0 +1,73 @@
+package callback
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SecretKeyHMAC is the key within the per-Dataset notify Secret that holds
+// the raw HMAC signing key.
+const SecretKeyHMAC = "hmacKey"
+
+// SecretName returns the name of the Secret holding a Dataset's HMAC
+// signing key, so both the reconciler (writing it) and the callback server
+// (reading it) agree on where to find it.
+func SecretName(datasetName string) string {
+	return datasetName + "-complete-notify"
+}
+
+// EnsureSecret returns the raw HMAC signing key for a Dataset, generating
+// and persisting a new random one the first time it's called so the key
+// stays stable across reconciles.
+func EnsureSecret(ctx context.Context, c client.Client, owner client.Object, scheme *runtime.Scheme) (string, error) {
+	name := SecretName(owner.GetName())
+
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: owner.GetNamespace(), Name: name}, secret)
+	if err == nil {
+		return string(secret.Data[SecretKeyHMAC]), nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	key, err := randomKey()
+	if err != nil {
+		return "", fmt.Errorf("generate HMAC key: %w", err)
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: owner.GetNamespace(),
+		},
+		Data: map[string][]byte{
+			SecretKeyHMAC: []byte(key),
+		},
+	}
+	if err := ctrl.SetControllerReference(owner, secret, scheme); err != nil {
+		return "", err
+	}
+	if err := c.Create(ctx, secret); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func randomKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
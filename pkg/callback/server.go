@@ -0,0 +1,184 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package callback runs a small HTTP server, embedded in the controller
+// process, that lets plugin pods report structured completion instead of a
+// best-effort fire-and-forget webhook to some external URL.
+package callback
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Payload is the JSON body a plugin POSTs to report completion.
+type Payload struct {
+	State     string             `json:"state"`
+	Message   string             `json:"message"`
+	Artifacts []string           `json:"artifacts"`
+	Metrics   map[string]float64 `json:"metrics"`
+}
+
+// SignatureHeader and DeliveryIDHeader are the headers a plugin sets on its
+// completion POST.
+const (
+	SignatureHeader  = "X-Signature"
+	DeliveryIDHeader = "X-Delivery-Id"
+)
+
+// SecretLookup resolves the HMAC signing key for a Dataset, so Server
+// doesn't need to know how that key is stored.
+type SecretLookup func(ctx context.Context, namespace, name string) (string, error)
+
+// StatusPatcher applies a completion Payload onto a Dataset's status.
+type StatusPatcher func(ctx context.Context, namespace, name string, payload Payload) error
+
+// Server receives POST /datasets/{namespace}/{name}/complete callbacks from
+// plugin pods.
+type Server struct {
+	Secret SecretLookup
+	Patch  StatusPatcher
+
+	mu        sync.Mutex
+	delivered map[string]bool // delivery ID -> whether it was applied successfully
+}
+
+// NewServer builds a callback Server. lookup resolves a Dataset's HMAC
+// secret and patch applies a verified Payload to that Dataset's status.
+func NewServer(lookup SecretLookup, patch StatusPatcher) *Server {
+	return &Server{Secret: lookup, Patch: patch, delivered: make(map[string]bool)}
+}
+
+// Handler returns the http.Handler to mount on the controller's HTTP server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/datasets/", s.handleComplete)
+	return mux
+}
+
+// handleComplete serves POST /datasets/{namespace}/{name}/complete.
+func (s *Server) handleComplete(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	namespace, name, err := parseCompletePath(req.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	deliveryID := req.Header.Get(DeliveryIDHeader)
+	if deliveryID == "" {
+		http.Error(w, "missing "+DeliveryIDHeader, http.StatusBadRequest)
+		return
+	}
+	if s.alreadyDelivered(deliveryID) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := s.Secret(req.Context(), namespace, name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("resolve notify secret: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !validSignature(secret, body, req.Header.Get(SignatureHeader)) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Patch(req.Context(), namespace, name, payload); err != nil {
+		// Leave the delivery unrecorded so the plugin's retry is accepted
+		// as a fresh attempt instead of being deduped away.
+		http.Error(w, fmt.Sprintf("patch dataset status: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.markDelivered(deliveryID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) alreadyDelivered(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delivered[id]
+}
+
+func (s *Server) markDelivered(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivered[id] = true
+}
+
+// parseCompletePath extracts namespace/name from `/datasets/{namespace}/{name}/complete`.
+func parseCompletePath(path string) (namespace, name string, err error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "datasets" || parts[3] != "complete" {
+		return "", "", fmt.Errorf("unexpected path %v", path)
+	}
+	return parts[1], parts[2], nil
+}
+
+// validSignature reports whether signature is the hex HMAC-SHA256 of body
+// under secret.
+func validSignature(secret string, body []byte, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	want := hex.EncodeToString(mac.Sum(nil))
+	return subtle.ConstantTimeCompare([]byte(want), []byte(signature)) == 1
+}
+
+// ClientSecretLookup builds a SecretLookup backed by a controller-runtime
+// client, reading the Secret EnsureSecret wrote for the Dataset.
+func ClientSecretLookup(c client.Client) SecretLookup {
+	return func(ctx context.Context, namespace, name string) (string, error) {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: SecretName(name)}, secret); err != nil {
+			return "", err
+		}
+		return string(secret.Data[SecretKeyHMAC]), nil
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package callback
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func signBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSignature(t *testing.T) {
+	body := []byte(`{"state":"succeeded"}`)
+	sig := signBody("s3cr3t", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", "s3cr3t", body, sig, true},
+		{"wrong secret", "other", body, sig, false},
+		{"wrong body", "s3cr3t", []byte(`{"state":"failed"}`), sig, false},
+		{"empty secret", "", body, sig, false},
+		{"empty signature", "s3cr3t", body, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validSignature(tt.secret, tt.body, tt.signature); got != tt.want {
+				t.Errorf("validSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCompletePath(t *testing.T) {
+	tests := []struct {
+		path          string
+		wantNamespace string
+		wantName      string
+		wantErr       bool
+	}{
+		{"/datasets/default/my-dataset/complete", "default", "my-dataset", false},
+		{"datasets/default/my-dataset/complete", "default", "my-dataset", false},
+		{"/datasets/default/my-dataset/complete/", "default", "my-dataset", false},
+		{"/datasets/default/my-dataset", "", "", true},
+		{"/datasets/default/my-dataset/status", "", "", true},
+		{"/other/default/my-dataset/complete", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			namespace, name, err := parseCompletePath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCompletePath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if namespace != tt.wantNamespace || name != tt.wantName {
+				t.Errorf("parseCompletePath(%q) = (%q, %q), want (%q, %q)", tt.path, namespace, name, tt.wantNamespace, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestHandleCompleteDedupesOnDeliveryID(t *testing.T) {
+	const secret = "s3cr3t"
+	body := []byte(`{"state":"succeeded"}`)
+
+	var patchCalls int
+	s := NewServer(
+		func(ctx context.Context, namespace, name string) (string, error) { return secret, nil },
+		func(ctx context.Context, namespace, name string, payload Payload) error {
+			patchCalls++
+			return nil
+		},
+	)
+
+	newReq := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/datasets/default/my-dataset/complete", bytes.NewReader(body))
+		req.Header.Set(SignatureHeader, signBody(secret, body))
+		req.Header.Set(DeliveryIDHeader, "delivery-1")
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, newReq())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first delivery: got status %v, want %v", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, newReq())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("duplicate delivery: got status %v, want %v", rec.Code, http.StatusOK)
+	}
+
+	if patchCalls != 1 {
+		t.Errorf("Patch called %d times, want 1 (duplicate X-Delivery-Id must be deduped)", patchCalls)
+	}
+}
@@ -11,6 +11,9 @@ func init() {
 	config.SetDefault("level", "debug")
 	// bind COMPLETE_NOTIFY_URL env var
 	config.BindEnv("complete_notify_url", "COMPLETE_NOTIFY_URL")
+	// bind CALLBACK_TLS_CERT_FILE/CALLBACK_TLS_KEY_FILE env vars
+	config.BindEnv("callback_tls_cert_file", "CALLBACK_TLS_CERT_FILE")
+	config.BindEnv("callback_tls_key_file", "CALLBACK_TLS_KEY_FILE")
 
 }
 
@@ -22,3 +25,16 @@ func GetLevel() string {
 func GetCompleteNotifyURL() string {
 	return config.GetString("complete_notify_url")
 }
+
+// GetCallbackTLSCertFile fetches CALLBACK_TLS_CERT_FILE env var, the path to
+// the TLS certificate the plugin completion callback server serves. Empty
+// when the callback server should run over plain HTTP.
+func GetCallbackTLSCertFile() string {
+	return config.GetString("callback_tls_cert_file")
+}
+
+// GetCallbackTLSKeyFile fetches CALLBACK_TLS_KEY_FILE env var, the private
+// key matching GetCallbackTLSCertFile.
+func GetCallbackTLSKeyFile() string {
+	return config.GetString("callback_tls_key_file")
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+)
+
+// PluginSource fetches a plugin bundle from wherever it's published and
+// returns its raw bytes together with a hex-encoded sha256 digest of the
+// content, so the caller can verify it against DataPlugin.Spec.Source.Digest.
+type PluginSource interface {
+	Fetch(ctx context.Context) (bundle []byte, digest string, err error)
+}
+
+// NewPluginSource builds the PluginSource implementation for uri's scheme.
+// Supported schemes are oci://, https:///http:// (a single plugin.yaml,
+// returned as served; a tarball is not unpacked) and git:// (a ref into a
+// git repository).
+func NewPluginSource(uri string) (PluginSource, error) {
+	switch {
+	case strings.HasPrefix(uri, "oci://"):
+		return &ociPluginSource{ref: strings.TrimPrefix(uri, "oci://")}, nil
+	case strings.HasPrefix(uri, "https://"), strings.HasPrefix(uri, "http://"):
+		return &httpPluginSource{url: uri}, nil
+	case strings.HasPrefix(uri, "git://"):
+		return &gitPluginSource{ref: strings.TrimPrefix(uri, "git://")}, nil
+	default:
+		return nil, fmt.Errorf("unsupported plugin source scheme: %v", uri)
+	}
+}
+
+// digestOf returns the hex sha256 digest of data, in the form used to
+// compare against DataPlugin.Spec.Source.Digest.
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ociPluginSource fetches a plugin bundle published as the single
+// `plugin.yaml` file of an OCI artifact, e.g. `oci://registry.example.com/plugins/hf-loader:v1`.
+type ociPluginSource struct {
+	ref string
+}
+
+func (s *ociPluginSource) Fetch(ctx context.Context) ([]byte, string, error) {
+	img, err := crane.Pull(s.ref, crane.WithContext(ctx))
+	if err != nil {
+		return nil, "", fmt.Errorf("pull %v: %w", s.ref, err)
+	}
+	layers, err := img.Layers()
+	if err != nil || len(layers) == 0 {
+		return nil, "", fmt.Errorf("read layers of %v: %w", s.ref, err)
+	}
+	rc, err := layers[len(layers)-1].Uncompressed()
+	if err != nil {
+		return nil, "", fmt.Errorf("read top layer of %v: %w", s.ref, err)
+	}
+	defer rc.Close()
+
+	data, err := extractPluginYAML(rc)
+	if err != nil {
+		return nil, "", fmt.Errorf("extract plugin.yaml from %v: %w", s.ref, err)
+	}
+	return data, digestOf(data), nil
+}
+
+// httpPluginSource fetches a plugin bundle served as a plain file over
+// HTTP(S), e.g. `https://plugins.example.com/hf-loader/plugin.yaml`.
+type httpPluginSource struct {
+	url string
+}
+
+func (s *httpPluginSource) Fetch(ctx context.Context) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch %v: %w", s.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetch %v: unexpected status %v", s.url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("read body of %v: %w", s.url, err)
+	}
+	return data, digestOf(data), nil
+}
+
+// gitPluginSource fetches a plugin bundle from a path inside a git
+// repository, e.g. `git://github.com/acme/plugins.git//hf-loader/plugin.yaml@main`.
+type gitPluginSource struct {
+	ref string
+}
+
+func (s *gitPluginSource) Fetch(ctx context.Context) ([]byte, string, error) {
+	repo, path, rev := parseGitRef(s.ref)
+	// NewPluginSource trimmed the scheme off s.ref; without it git would
+	// treat repo as a local path instead of a remote.
+	repo = "git://" + repo
+
+	dir, err := cloneShallow(ctx, repo, rev)
+	if err != nil {
+		return nil, "", fmt.Errorf("clone %v: %w", repo, err)
+	}
+	defer removeAll(dir)
+
+	data, err := readFile(dir, path)
+	if err != nil {
+		return nil, "", fmt.Errorf("read %v from %v: %w", path, repo, err)
+	}
+	return data, digestOf(data), nil
+}
+
+// cloneShallow runs `git clone --depth=1 --branch <rev> <repo> <tmpdir>` and
+// returns the temporary directory it cloned into.
+func cloneShallow(ctx context.Context, repo, rev string) (string, error) {
+	if err := validateGitArg(repo); err != nil {
+		return "", fmt.Errorf("invalid repo: %w", err)
+	}
+	if rev != "" {
+		if err := validateGitArg(rev); err != nil {
+			return "", fmt.Errorf("invalid rev: %w", err)
+		}
+	}
+
+	dir, err := mkdtemp("plugin-source-git-")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"clone", "--depth=1"}
+	if rev != "" {
+		args = append(args, "--branch", rev)
+	}
+	// "--" stops git from treating repo as an option even if a caller
+	// manages to smuggle a leading "-" past validateGitArg.
+	args = append(args, "--", repo, dir)
+	if out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput(); err != nil {
+		removeAll(dir)
+		return "", fmt.Errorf("%w: %s", err, out)
+	}
+	return dir, nil
+}
+
+// validateGitArg rejects a repo or rev that could be mistaken for a command
+// line option by git, e.g. `--upload-pack=...` smuggled in through
+// DataPlugin.Spec.Source.URI.
+func validateGitArg(arg string) error {
+	if arg == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	if strings.HasPrefix(arg, "-") {
+		return fmt.Errorf("must not start with '-': %q", arg)
+	}
+	return nil
+}
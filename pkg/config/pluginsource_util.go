@@ -0,0 +1,64 @@
+package config
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractPluginYAML reads a tar stream (an OCI layer) looking for the
+// bundle's plugin.yaml entry.
+func extractPluginYAML(r io.Reader) ([]byte, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("plugin.yaml not found in layer")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Base(hdr.Name) == "plugin.yaml" {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// parseGitRef splits a git source ref of the form
+// `<repo>[//<path-within-repo>][@<rev>]` into its parts. path defaults to
+// plugin.yaml at the repository root, and rev defaults to the repository's
+// default branch.
+func parseGitRef(ref string) (repo, path, rev string) {
+	if at := strings.LastIndex(ref, "@"); at != -1 {
+		ref, rev = ref[:at], ref[at+1:]
+	}
+	if slashes := strings.Index(ref, "//"); slashes != -1 {
+		repo, path = ref[:slashes], ref[slashes+2:]
+	} else {
+		repo, path = ref, "plugin.yaml"
+	}
+	return repo, path, rev
+}
+
+func mkdtemp(prefix string) (string, error) {
+	return os.MkdirTemp("", prefix)
+}
+
+func removeAll(dir string) {
+	_ = os.RemoveAll(dir)
+}
+
+// readFile reads path relative to dir, the temporary directory a plugin
+// bundle repo was cloned into. path comes from
+// DataPlugin.Spec.Source.URI, so it's resolved and checked against dir
+// before reading, rejecting a `../` escape out of the clone.
+func readFile(dir, path string) ([]byte, error) {
+	full := filepath.Join(dir, path)
+	if full != dir && !strings.HasPrefix(full, dir+string(filepath.Separator)) {
+		return nil, fmt.Errorf("path %q escapes repository root", path)
+	}
+	return os.ReadFile(full)
+}
@@ -0,0 +1,50 @@
+// Package resourceset tracks the set of Kubernetes objects a plugin bundle
+// applied for a Dataset, so the controller can diff that set across
+// reconciles and garbage-collect resources that drop out of it.
+//
+// The set is recorded as a JSON-encoded Dataset annotation rather than a
+// typed Dataset.Status field: Dataset's API type lives in the separate
+// github.com/DataTunerX/meta-server module, and this repo doesn't control
+// (or vendor) that module's Go source, so it can't declare a Status field of
+// a type defined here without an import cycle. Annotation storage needs
+// nothing from meta-server beyond the ObjectMeta every Kubernetes object
+// already has.
+package resourceset
+
+import "encoding/json"
+
+// Item identifies a single applied object by GVK + namespace + name.
+type Item struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// Annotation is the key a Dataset's applied resource set is stored under.
+const Annotation = "extension.datatunerx.io/applied-resources"
+
+// Encode serializes items for storage under Annotation.
+func Encode(items []Item) (string, error) {
+	if len(items) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Decode parses the value Encode wrote. An empty value decodes to an empty
+// set, so a Dataset that has never had a bundle applied doesn't error.
+func Decode(raw string) ([]Item, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var items []Item
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
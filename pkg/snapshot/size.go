@@ -0,0 +1,50 @@
+package snapshot
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// defaultSnapshotSize is used whenever the source kind gives no better hint
+// about how large the resulting PVC should be.
+var defaultSnapshotSize = resource.MustParse("20Gi")
+
+// SizeForSource returns a PVC size request for a dataset source URL. It's a
+// coarse heuristic keyed on the source kind, not a byte-accurate estimate:
+// HuggingFace and git sources tend to be whole-repo checkouts and get more
+// headroom than a single HTTP/S3 object.
+func SizeForSource(sourceURL string) resource.Quantity {
+	switch detectSourceKind(sourceURL) {
+	case SourceKindHuggingFace, SourceKindGit:
+		return resource.MustParse("50Gi")
+	default:
+		return defaultSnapshotSize
+	}
+}
+
+// SourceKind classifies a Dataset source URL so the Manager knows roughly
+// how much space to request. The snapshot Job is not told the kind; it gets
+// only the source URL and revision.
+type SourceKind string
+
+const (
+	SourceKindHTTP        SourceKind = "http"
+	SourceKindS3          SourceKind = "s3"
+	SourceKindHuggingFace SourceKind = "huggingface"
+	SourceKindGit         SourceKind = "git"
+)
+
+// detectSourceKind classifies sourceURL by scheme/host.
+func detectSourceKind(sourceURL string) SourceKind {
+	switch {
+	case strings.HasPrefix(sourceURL, "s3://"):
+		return SourceKindS3
+	case strings.HasPrefix(sourceURL, "git://"), strings.HasSuffix(sourceURL, ".git"):
+		return SourceKindGit
+	case strings.Contains(sourceURL, "huggingface.co"):
+		return SourceKindHuggingFace
+	default:
+		return SourceKindHTTP
+	}
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package snapshot materializes a Dataset's source data onto a PVC once, so
+// that downstream fine-tuning jobs can mount it by name instead of
+// re-downloading the same HTTP/S3/HuggingFace/git source on every run.
+package snapshot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultSnapshotterImage runs the download/split/hash step inside the Job
+// the Manager launches.
+const defaultSnapshotterImage = "docker.io/datatunerx/dataset-snapshotter:latest"
+
+// Status is the result of reconciling a Dataset's snapshot, meant to be
+// copied onto Dataset.Status.Snapshot.
+type Status struct {
+	PVCName      string `json:"pvcName,omitempty"`
+	SourceDigest string `json:"sourceDigest,omitempty"`
+	ContentHash  string `json:"contentHash,omitempty"`
+	Ready        bool   `json:"ready"`
+}
+
+// Manager provisions and tracks the PVC + Job pair that materializes a
+// Dataset's source data.
+type Manager struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Image is the snapshotter image the download Job runs; defaults to
+	// defaultSnapshotterImage when unset.
+	Image string
+}
+
+// NewManager builds a Manager using the reconciler's client and scheme.
+func NewManager(c client.Client, scheme *runtime.Scheme) *Manager {
+	return &Manager{Client: c, Scheme: scheme}
+}
+
+// SourceDigest hashes a source URL + revision pair into the value compared
+// against Status.Snapshot.SourceDigest to decide whether a re-snapshot is
+// needed.
+func SourceDigest(sourceURL, revision string) string {
+	sum := sha256.Sum256([]byte(sourceURL + "@" + revision))
+	return hex.EncodeToString(sum[:])
+}
+
+// owner is the subset of Dataset the snapshot Manager needs: enough to name
+// and own the PVC/Job it creates, without importing the meta-server API and
+// creating an import cycle.
+type owner interface {
+	client.Object
+}
+
+// Ensure makes sure dataset's source has been snapshotted onto a PVC,
+// creating the PVC and download Job on first use and skipping both once
+// current.SourceDigest already matches sourceURL+revision. It returns the
+// up-to-date Status, whose Ready field says whether the snapshot is ready
+// for downstream use.
+//
+// The PVC/Job pair is named from digest, not just the Dataset's name: a
+// fixed name would let ensureJob's Get find and return the previous,
+// already-Succeeded Job from an earlier source even after sourceURL or
+// revision changed, serving stale PVC data under a newly stamped digest.
+// Keying on digest guarantees a source change always gets a fresh PVC+Job.
+func (m *Manager) Ensure(ctx context.Context, ds owner, current Status, sourceURL, revision string) (Status, error) {
+	digest := SourceDigest(sourceURL, revision)
+	if current.SourceDigest == digest && current.Ready {
+		return current, nil
+	}
+
+	pvcName := snapshotName(ds.GetName(), digest)
+	if current.PVCName != "" && current.PVCName != pvcName {
+		if err := m.deleteStaleSnapshot(ctx, ds.GetNamespace(), current.PVCName); err != nil {
+			return current, fmt.Errorf("delete stale snapshot for previous source: %w", err)
+		}
+	}
+
+	if err := m.ensurePVC(ctx, ds, pvcName, sourceURL); err != nil {
+		return current, fmt.Errorf("ensure snapshot PVC: %w", err)
+	}
+
+	jobName := pvcName + "-job"
+	job, err := m.ensureJob(ctx, ds, jobName, pvcName, sourceURL, revision)
+	if err != nil {
+		return current, fmt.Errorf("ensure snapshot job: %w", err)
+	}
+
+	status := Status{PVCName: pvcName, SourceDigest: digest}
+	switch {
+	case jobSucceeded(job):
+		status.Ready = true
+		status.ContentHash, err = m.readContentHash(ctx, ds.GetNamespace(), pvcName)
+		if err != nil {
+			return status, fmt.Errorf("read snapshot content hash: %w", err)
+		}
+	case jobFailed(job):
+		// Delete the failed Job so the next Ensure call's ensureJob doesn't
+		// just find and return the same failed Job again: without this, a
+		// Dataset whose source is unreachable would fail once and then
+		// never retry. SourceDigest is left set on the returned Status so
+		// the caller keeps retrying this source+revision rather than
+		// silently re-snapshotting from scratch.
+		if err := m.Delete(ctx, job); err != nil && !apierrors.IsNotFound(err) {
+			return status, fmt.Errorf("delete failed snapshot job %v/%v: %w", ds.GetNamespace(), jobName, err)
+		}
+		return status, fmt.Errorf("snapshot job %v/%v failed", ds.GetNamespace(), jobName)
+	}
+	return status, nil
+}
+
+// snapshotName derives the PVC name (and, via "-job"/"-digest" suffixes, the
+// Job and content-hash ConfigMap names) for a source+revision digest, so a
+// changed source always provisions a fresh PVC/Job instead of reusing one
+// populated from the old source.
+func snapshotName(datasetName, digest string) string {
+	return datasetName + "-snapshot-" + digest[:12]
+}
+
+// deleteStaleSnapshot tears down the Job, content-hash ConfigMap, and PVC
+// left behind by a previous source+revision once Ensure has moved on to a
+// new one, so switching a Dataset's source doesn't leak a PVC per change.
+func (m *Manager) deleteStaleSnapshot(ctx context.Context, namespace, pvcName string) error {
+	foreground := metav1.DeletePropagationForeground
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: pvcName + "-job"}}
+	if err := m.Delete(ctx, job, &client.DeleteOptions{PropagationPolicy: &foreground}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: pvcName + "-digest"}}
+	if err := m.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: pvcName}}
+	if err := m.Delete(ctx, pvc); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) ensurePVC(ctx context.Context, ds owner, name, sourceURL string) error {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := m.Get(ctx, types.NamespacedName{Namespace: ds.GetNamespace(), Name: name}, pvc)
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	pvc = &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ds.GetNamespace(),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: SizeForSource(sourceURL),
+				},
+			},
+		},
+	}
+	if err := ctrl.SetControllerReference(ds, pvc, m.Scheme); err != nil {
+		return err
+	}
+	return m.Create(ctx, pvc)
+}
+
+func (m *Manager) ensureJob(ctx context.Context, ds owner, name, pvcName, sourceURL, revision string) (*batchv1.Job, error) {
+	job := &batchv1.Job{}
+	err := m.Get(ctx, types.NamespacedName{Namespace: ds.GetNamespace(), Name: name}, job)
+	if err == nil {
+		return job, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	image := m.Image
+	if image == "" {
+		image = defaultSnapshotterImage
+	}
+
+	job = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ds.GetNamespace(),
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyOnFailure,
+					Containers: []corev1.Container{
+						{
+							Name:  "snapshot",
+							Image: image,
+							Env: []corev1.EnvVar{
+								{Name: "SOURCE_URL", Value: sourceURL},
+								{Name: "SOURCE_REVISION", Value: revision},
+								{Name: "OUT_DIR", Value: "/data"},
+								{Name: "DIGEST_CONFIGMAP", Value: pvcName + "-digest"},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "data", MountPath: "/data"},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "data",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvcName},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := ctrl.SetControllerReference(ds, job, m.Scheme); err != nil {
+		return nil, err
+	}
+	if err := m.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// readContentHash reads the content hash the snapshot Job computed while
+// splitting train/test and writing the data, published as a ConfigMap since
+// a Job has no other channel back to the controller.
+func (m *Manager) readContentHash(ctx context.Context, namespace, pvcName string) (string, error) {
+	cm := &corev1.ConfigMap{}
+	if err := m.Get(ctx, types.NamespacedName{Namespace: namespace, Name: pvcName + "-digest"}, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return cm.Data["contentHash"], nil
+}
+
+func jobSucceeded(job *batchv1.Job) bool {
+	return job != nil && job.Status.Succeeded > 0
+}
+
+func jobFailed(job *batchv1.Job) bool {
+	return job != nil && job.Status.Failed > 0
+}
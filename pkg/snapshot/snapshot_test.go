@@ -0,0 +1,190 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newManager(t *testing.T) *Manager {
+	t.Helper()
+	return &Manager{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(),
+		Scheme: scheme.Scheme,
+	}
+}
+
+func newDataset(name, namespace string) *corev1.ConfigMap {
+	// owner only needs client.Object, and ctrl.SetControllerReference only
+	// needs a type known to the scheme; a ConfigMap stands in for the
+	// Dataset so this package's tests don't need the meta-server API.
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+}
+
+func TestEnsureSkipsWhenAlreadyReadyAtDigest(t *testing.T) {
+	m := newManager(t)
+	ds := newDataset("my-dataset", "default")
+	current := Status{PVCName: "my-dataset-snapshot-aaaaaaaaaaaa", SourceDigest: SourceDigest("https://example.com/data", "v1"), Ready: true}
+
+	got, err := m.Ensure(context.Background(), ds, current, "https://example.com/data", "v1")
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	if got != current {
+		t.Errorf("Ensure() = %+v, want unchanged %+v", got, current)
+	}
+}
+
+func TestEnsureCreatesPVCAndJobOnFirstUse(t *testing.T) {
+	m := newManager(t)
+	ds := newDataset("my-dataset", "default")
+
+	status, err := m.Ensure(context.Background(), ds, Status{}, "https://example.com/data", "v1")
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	if status.Ready {
+		t.Errorf("Ensure() Ready = true on first use, want false until the Job succeeds")
+	}
+	if status.PVCName == "" {
+		t.Errorf("Ensure() PVCName is empty, want a provisioned PVC name")
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := m.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: status.PVCName}, pvc); err != nil {
+		t.Errorf("expected PVC %v to exist: %v", status.PVCName, err)
+	}
+	job := &batchv1.Job{}
+	if err := m.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: status.PVCName + "-job"}, job); err != nil {
+		t.Errorf("expected Job %v to exist: %v", status.PVCName+"-job", err)
+	}
+}
+
+func TestEnsureReportsReadyOnJobSuccess(t *testing.T) {
+	m := newManager(t)
+	ds := newDataset("my-dataset", "default")
+	digest := SourceDigest("https://example.com/data", "v1")
+	pvcName := snapshotName("my-dataset", digest)
+
+	mustCreate(t, m, &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: pvcName, Namespace: "default"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources:   corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: SizeForSource("https://example.com/data")}},
+		},
+	})
+	mustCreate(t, m, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: pvcName + "-job", Namespace: "default"}})
+	mustCreate(t, m, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: pvcName + "-digest", Namespace: "default"},
+		Data:       map[string]string{"contentHash": "deadbeef"},
+	})
+
+	job := &batchv1.Job{}
+	if err := m.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: pvcName + "-job"}, job); err != nil {
+		t.Fatalf("get job: %v", err)
+	}
+	job.Status.Succeeded = 1
+	if err := m.Status().Update(context.Background(), job); err != nil {
+		// Falls back to a plain Update for clients that don't split the
+		// status subresource.
+		if err := m.Update(context.Background(), job); err != nil {
+			t.Fatalf("set job succeeded: %v", err)
+		}
+	}
+
+	status, err := m.Ensure(context.Background(), ds, Status{PVCName: pvcName, SourceDigest: digest}, "https://example.com/data", "v1")
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	if !status.Ready {
+		t.Errorf("Ensure() Ready = false, want true once the Job has succeeded")
+	}
+	if status.ContentHash != "deadbeef" {
+		t.Errorf("Ensure() ContentHash = %q, want %q", status.ContentHash, "deadbeef")
+	}
+}
+
+func TestEnsureDeletesFailedJobSoItCanBeRetried(t *testing.T) {
+	m := newManager(t)
+	ds := newDataset("my-dataset", "default")
+	digest := SourceDigest("https://example.com/data", "v1")
+	pvcName := snapshotName("my-dataset", digest)
+
+	mustCreate(t, m, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: pvcName, Namespace: "default"}})
+	mustCreate(t, m, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: pvcName + "-job", Namespace: "default"}})
+
+	job := &batchv1.Job{}
+	if err := m.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: pvcName + "-job"}, job); err != nil {
+		t.Fatalf("get job: %v", err)
+	}
+	job.Status.Failed = 1
+	if err := m.Update(context.Background(), job); err != nil {
+		t.Fatalf("set job failed: %v", err)
+	}
+
+	_, err := m.Ensure(context.Background(), ds, Status{PVCName: pvcName, SourceDigest: digest}, "https://example.com/data", "v1")
+	if err == nil {
+		t.Fatal("Ensure() error = nil, want an error reporting the failed Job")
+	}
+
+	if err := m.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: pvcName + "-job"}, &batchv1.Job{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected failed Job to be deleted so it can be recreated, got err = %v", err)
+	}
+}
+
+func TestEnsureRecreatesSnapshotOnSourceChange(t *testing.T) {
+	m := newManager(t)
+	ds := newDataset("my-dataset", "default")
+	oldPVCName := "my-dataset-snapshot-oldoldoldo"
+
+	mustCreate(t, m, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: oldPVCName, Namespace: "default"}})
+	mustCreate(t, m, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: oldPVCName + "-job", Namespace: "default"}})
+
+	current := Status{PVCName: oldPVCName, SourceDigest: SourceDigest("https://example.com/old", "v1"), Ready: true}
+
+	status, err := m.Ensure(context.Background(), ds, current, "https://example.com/new", "v1")
+	if err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	if status.PVCName == oldPVCName {
+		t.Fatalf("Ensure() PVCName = %v, want a fresh name for the new source", status.PVCName)
+	}
+
+	if err := m.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: oldPVCName}, &corev1.PersistentVolumeClaim{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected stale PVC %v from the previous source to be deleted, got err = %v", oldPVCName, err)
+	}
+	if err := m.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: status.PVCName}, &corev1.PersistentVolumeClaim{}); err != nil {
+		t.Errorf("expected new PVC %v to exist: %v", status.PVCName, err)
+	}
+}
+
+func mustCreate(t *testing.T, m *Manager, obj client.Object) {
+	t.Helper()
+	if err := m.Client.Create(context.Background(), obj); err != nil {
+		t.Fatalf("create %T: %v", obj, err)
+	}
+}
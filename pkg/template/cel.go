@@ -0,0 +1,74 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/google/cel-go/cel"
+)
+
+// celBlock matches a `{{cel: <expr>}}` validation predicate. Unlike the
+// other template actions, a cel block isn't substituted with a value: it's
+// evaluated and, if it isn't true, fails the render outright.
+var celBlock = regexp.MustCompile(`\{\{\s*cel:\s*(.*?)\s*\}\}`)
+
+// evalCELPredicates evaluates every `{{cel: ...}}` block in tmpl against
+// tctx and strips them from the template, so text/template never sees them.
+// Each expression must evaluate to a bool; a false result fails the render
+// with the offending expression, so a malformed plugin bundle is rejected
+// before anything is applied.
+func evalCELPredicates(tmpl string, tctx Context) (string, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("Dataset", cel.DynType),
+		cel.Variable("Params", cel.DynType),
+		cel.Variable("Env", cel.DynType),
+	)
+	if err != nil {
+		return "", fmt.Errorf("build CEL environment: %w", err)
+	}
+
+	vars := map[string]interface{}{
+		"Dataset": tctx.Dataset,
+		"Params":  tctx.Params,
+		"Env":     tctx.Env,
+	}
+
+	var evalErr error
+	result := celBlock.ReplaceAllStringFunc(tmpl, func(match string) string {
+		if evalErr != nil {
+			return ""
+		}
+		expr := celBlock.FindStringSubmatch(match)[1]
+
+		ast, issues := env.Compile(expr)
+		if issues != nil && issues.Err() != nil {
+			evalErr = fmt.Errorf("compile CEL expression %q: %w", expr, issues.Err())
+			return ""
+		}
+		prg, err := env.Program(ast)
+		if err != nil {
+			evalErr = fmt.Errorf("build CEL program %q: %w", expr, err)
+			return ""
+		}
+		out, _, err := prg.Eval(vars)
+		if err != nil {
+			evalErr = fmt.Errorf("evaluate CEL expression %q: %w", expr, err)
+			return ""
+		}
+		ok, isBool := out.Value().(bool)
+		if !isBool {
+			evalErr = fmt.Errorf("CEL expression %q did not evaluate to a bool", expr)
+			return ""
+		}
+		if !ok {
+			evalErr = fmt.Errorf("CEL validation predicate failed: %v", expr)
+			return ""
+		}
+		return ""
+	})
+
+	if evalErr != nil {
+		return "", evalErr
+	}
+	return result, nil
+}
@@ -0,0 +1,44 @@
+package template
+
+// EnvAllowlist names the only controller process environment variables a
+// plugin bundle template may read via .Env. Keep this list narrow: anything
+// added here becomes readable by bundles sourced from arbitrary OCI/HTTP/git
+// locations.
+var EnvAllowlist = []string{
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"CLUSTER_DOMAIN",
+}
+
+// ClusterInfo exposes cluster-level facts a plugin bundle template can
+// reference, without granting it a live client of its own.
+type ClusterInfo struct {
+	// Namespace is the Dataset's own namespace, where secretRef/configMapRef
+	// resolve relative names against.
+	Namespace string
+	// ControllerNamespace is the namespace dataset-controller itself runs
+	// in, e.g. to reference shared, cluster-wide ConfigMaps.
+	ControllerNamespace string
+}
+
+// Context is the data a plugin bundle template renders against.
+type Context struct {
+	// Dataset is the owning Dataset, rendered to a plain map so templates
+	// can dot into any field (e.g. `.Dataset.spec.datasetMetadata...`)
+	// without the template package importing the meta-server API.
+	Dataset map[string]interface{}
+	// Params holds Plugin.Parameters plus the fields the controller injects
+	// (completeNotifyUrl, completeNotifySecret, ...).
+	Params map[string]interface{}
+	// Env exposes a fixed allowlist of the controller process's environment
+	// variables (see EnvAllowlist) — never the full environment. Plugin
+	// bundles are rendered against sources a cluster operator configured
+	// (DataPlugin.Spec.Source may point at an arbitrary OCI/HTTP/git
+	// location), so handing a template the whole process environment would
+	// let a malicious bundle exfiltrate credentials it has no business
+	// seeing.
+	Env map[string]string
+	// Cluster carries namespace information, see ClusterInfo.
+	Cluster ClusterInfo
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package template renders a plugin bundle document against a Context
+// exposing the owning Dataset, its run-time Parameters, the controller's
+// Env, and Cluster info, with secretRef/configMapRef/b64enc/default/required
+// functions and {{cel: ...}} validation predicates. It replaces the bare
+// string substitution `parser.ReplaceTemplate` used to perform, so plugin
+// authors can pull credentials and cluster facts into their bundle instead
+// of embedding them in Plugin.Parameters.
+package template
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Engine renders plugin bundle documents, resolving secretRef/configMapRef
+// against a live client scoped to the Dataset's namespace.
+type Engine struct {
+	Client client.Client
+}
+
+// NewEngine builds an Engine backed by c.
+func NewEngine(c client.Client) *Engine {
+	return &Engine{Client: c}
+}
+
+// Render evaluates any {{cel: ...}} validation predicates in tmpl, then
+// executes it as a Go template against tctx.
+func (e *Engine) Render(ctx context.Context, tmpl string, tctx Context) (string, error) {
+	withoutPredicates, err := evalCELPredicates(tmpl, tctx)
+	if err != nil {
+		return "", err
+	}
+
+	funcs := template.FuncMap{
+		"secretRef":    secretRefFunc(ctx, e.Client, tctx.Cluster.Namespace),
+		"configMapRef": configMapRefFunc(ctx, e.Client, tctx.Cluster.Namespace),
+		"b64enc":       b64enc,
+		"default":      defaultValue,
+		"required":     requiredValue,
+	}
+
+	t, err := template.New("plugin-bundle").Funcs(funcs).Option("missingkey=error").Parse(withoutPredicates)
+	if err != nil {
+		return "", fmt.Errorf("parse plugin bundle template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, tctx); err != nil {
+		return "", fmt.Errorf("render plugin bundle template: %w", err)
+	}
+	return buf.String(), nil
+}
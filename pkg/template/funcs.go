@@ -0,0 +1,82 @@
+package template
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// b64enc matches the Helm/sprig function of the same name, used to inline
+// binary-ish values (TLS certs, tokens) into a plugin bundle.
+func b64enc(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// defaultValue returns val unless it's nil or the empty string, in which
+// case it returns def; other zero values such as 0 or false are kept.
+// Argument order matches Helm's `default` pipeline function:
+// `{{ .Params.replicas | default 1 }}`. A key absent from .Params fails the
+// render before default runs, since templates execute with missingkey=error.
+func defaultValue(def, val interface{}) interface{} {
+	if isEmpty(val) {
+		return def
+	}
+	return val
+}
+
+// requiredValue fails template rendering with msg when val is empty,
+// instead of silently substituting the zero value into the bundle.
+func requiredValue(msg string, val interface{}) (interface{}, error) {
+	if isEmpty(val) {
+		return nil, fmt.Errorf("%v", msg)
+	}
+	return val, nil
+}
+
+func isEmpty(val interface{}) bool {
+	switch v := val.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	default:
+		return false
+	}
+}
+
+// secretRefFunc returns a template function that fetches key from Secret
+// name in namespace, failing the render with a clear error when either is
+// missing, so plugin credentials can be referenced instead of embedded in
+// Parameters.
+func secretRefFunc(ctx context.Context, c client.Client, namespace string) func(name, key string) (string, error) {
+	return func(name, key string) (string, error) {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+			return "", fmt.Errorf("secretRef %v/%v: %w", namespace, name, err)
+		}
+		value, ok := secret.Data[key]
+		if !ok {
+			return "", fmt.Errorf("secretRef %v/%v: key %q not found", namespace, name, key)
+		}
+		return string(value), nil
+	}
+}
+
+// configMapRefFunc mirrors secretRefFunc for ConfigMaps.
+func configMapRefFunc(ctx context.Context, c client.Client, namespace string) func(name, key string) (string, error) {
+	return func(name, key string) (string, error) {
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, cm); err != nil {
+			return "", fmt.Errorf("configMapRef %v/%v: %w", namespace, name, err)
+		}
+		value, ok := cm.Data[key]
+		if !ok {
+			return "", fmt.Errorf("configMapRef %v/%v: key %q not found", namespace, name, key)
+		}
+		return value, nil
+	}
+}